@@ -73,6 +73,12 @@ type Packet struct {
 	refcount     int64
 	bytes        []byte
 	initialBytes [_PREPAYLOAD_SIZE + _MIN_PAYLOAD_CAP]byte
+
+	// compressedSize and decompressedSize are only set when this packet
+	// went through PacketConn's compression path, either on send or on
+	// receive. They are both 0 for a packet that was never compressed.
+	compressedSize   uint32
+	decompressedSize uint32
 }
 
 func allocPacket() *Packet {
@@ -103,7 +109,7 @@ func (p *Packet) AssureCapacity(need uint32) {
 	resizeToCap := getPayloadCapOfPayloadLen(requireCap)
 
 	buffer := packetBufferPools[resizeToCap].Get().([]byte)
-	if len(buffer) != int(resizeToCap+_SIZE_FIELD_SIZE) {
+	if len(buffer) != int(resizeToCap+_PREPAYLOAD_SIZE) {
 		panic(fmt.Errorf("buffer size should be %d, but is %d", resizeToCap, len(buffer)))
 	}
 	copy(buffer, p.data())
@@ -174,6 +180,8 @@ func (p *Packet) Release() {
 
 		p.readCursor = 0
 		p.setPayloadLen(0)
+		p.compressedSize = 0
+		p.decompressedSize = 0
 		packetPool.Put(p)
 	} else if refcount < 0 {
 		panic(fmt.Errorf("releasing packet with refcount=%d", p.refcount))
@@ -239,6 +247,74 @@ func (p *Packet) PopUint32() (v uint32) {
 	return
 }
 
+// AppendVarUint appends an unsigned integer to the end of payload using a
+// varint (LEB128-style) encoding: each byte carries 7 bits of the value,
+// with the high bit set on every byte except the last.
+func (p *Packet) AppendVarUint(v uint64) {
+	for v >= 0x80 {
+		p.AppendByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	p.AppendByte(byte(v))
+}
+
+// AppendVarInt appends a signed integer to the end of payload using
+// zigzag encoding on top of AppendVarUint, so small negative numbers
+// stay small on the wire.
+func (p *Packet) AppendVarInt(v int64) {
+	p.AppendVarUint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+// ReadVarUint reads a varint-encoded unsigned integer from the beginning
+// of unread payload. It panics if the varint does not terminate within
+// 10 bytes (the max length for a uint64).
+func (p *Packet) ReadVarUint() (v uint64) {
+	var shift uint
+	for i := 0; i < 10; i++ {
+		b := p.ReadOneByte()
+		v |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return v
+		}
+		shift += 7
+	}
+	panic(fmt.Errorf("ReadVarUint: varint is longer than 10 bytes"))
+}
+
+// ReadVarInt reads a zigzag+varint-encoded signed integer from the
+// beginning of unread payload.
+func (p *Packet) ReadVarInt() int64 {
+	uv := p.ReadVarUint()
+	return int64(uv>>1) ^ -int64(uv&1)
+}
+
+// AppendVarStrV appends a varsize string to the end of payload, prefixed
+// by a varint length. This is more compact than AppendVarStr for the
+// common case of short strings.
+func (p *Packet) AppendVarStrV(s string) {
+	p.AppendVarBytesV([]byte(s))
+}
+
+// AppendVarBytesV appends varsize bytes to the end of payload, prefixed
+// by a varint length.
+func (p *Packet) AppendVarBytesV(v []byte) {
+	p.AppendVarUint(uint64(len(v)))
+	p.AppendBytes(v)
+}
+
+// ReadVarStrV reads a varint-length-prefixed string from the beginning
+// of unread payload.
+func (p *Packet) ReadVarStrV() string {
+	return string(p.ReadVarBytesV())
+}
+
+// ReadVarBytesV reads a varint-length-prefixed slice of bytes from the
+// beginning of unread payload.
+func (p *Packet) ReadVarBytesV() []byte {
+	blen := p.ReadVarUint()
+	return p.ReadBytes(uint32(blen))
+}
+
 // AppendUint64 appends one uint64 to the end of payload
 func (p *Packet) AppendUint64(v uint64) {
 	p.AssureCapacity(8)
@@ -291,6 +367,32 @@ func (p *Packet) AppendBytes(v []byte) {
 	*(*uint32)(unsafe.Pointer(&p.bytes[0])) += bytesLen
 }
 
+// PreallocatedPayloadBuffer reserves capHint bytes of payload capacity
+// via AssureCapacity and returns them as a zero-length slice backed by
+// the packet's own pooled buffer, so a caller that appends into it
+// (e.g. a Compressor) writes straight into the packet instead of
+// allocating its own buffer and forcing AdoptPayload to copy. Pass the
+// result to AdoptPayload once the caller is done writing.
+func (p *Packet) PreallocatedPayloadBuffer(capHint uint32) []byte {
+	p.AssureCapacity(capHint)
+	return p.bytes[_PREPAYLOAD_SIZE : _PREPAYLOAD_SIZE : _PREPAYLOAD_SIZE+p.PayloadCap()]
+}
+
+// AdoptPayload finishes filling the packet after a caller wrote into the
+// slice returned by PreallocatedPayloadBuffer. If result still shares
+// that backing array (the common case, when the write fit inside the
+// reserved capacity) this just records the new length; otherwise (the
+// writer outgrew the reservation and allocated its own buffer) the data
+// is copied in the normal way.
+func (p *Packet) AdoptPayload(result []byte) {
+	if len(result) > 0 && len(p.bytes) > _PREPAYLOAD_SIZE && &result[0] == &p.bytes[_PREPAYLOAD_SIZE] {
+		p.setPayloadLen(uint32(len(result)))
+		return
+	}
+	p.ClearPayload()
+	p.AppendBytes(result)
+}
+
 // AppendVarStr appends a varsize string to the end of payload
 func (p *Packet) AppendVarStr(s string) {
 	p.AppendVarBytesH([]byte(s))
@@ -415,4 +517,25 @@ func (p *Packet) GetPayloadLen() uint32 {
 func (p *Packet) setPayloadLen(plen uint32) {
 	pplen := (*uint32)(unsafe.Pointer(&p.bytes[0]))
 	*pplen = plen
+}
+
+func (p *Packet) getFlags() byte {
+	return p.bytes[_SIZE_FIELD_SIZE]
+}
+
+func (p *Packet) setFlags(flags byte) {
+	p.bytes[_SIZE_FIELD_SIZE] = flags
+}
+
+// CompressedSize returns the on-wire size of the payload if PacketConn
+// sent or received this packet compressed, or 0 if it never was.
+func (p *Packet) CompressedSize() uint32 {
+	return p.compressedSize
+}
+
+// DecompressedSize returns the original, uncompressed size of the
+// payload if PacketConn sent or received this packet compressed, or 0
+// if it never was.
+func (p *Packet) DecompressedSize() uint32 {
+	return p.decompressedSize
 }
\ No newline at end of file
@@ -0,0 +1,389 @@
+package packetconn
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	_SIZE_FIELD_SIZE  = 4
+	_FLAGS_FIELD_SIZE = 1
+	_PREPAYLOAD_SIZE  = _SIZE_FIELD_SIZE + _FLAGS_FIELD_SIZE
+
+	_MAX_PAYLOAD_LENGTH = uint32(64 * 1024 * 1024)
+
+	_RECV_CHAN_SIZE = 1000
+	_SEND_CHAN_SIZE = 1000
+
+	// _FLAG_COMPRESSED marks that the payload was compressed by the
+	// codec identified by the remaining bits of the flags byte.
+	_FLAG_COMPRESSED     = byte(1 << 0)
+	_COMPRESSOR_ID_SHIFT = 1
+	_COMPRESSOR_ID_MASK  = byte(0x0F)
+
+	// _HANDSHAKE_TIMEOUT bounds how long the initial codec-negotiation
+	// handshake may take before NewPacketConn gives up on compression.
+	_HANDSHAKE_TIMEOUT = 5 * time.Second
+)
+
+// PacketConnOption configures optional behavior of a PacketConn created
+// by NewPacketConn.
+type PacketConnOption func(*packetConnOptions)
+
+type packetConnOptions struct {
+	compressor           Compressor
+	compressionThreshold uint32
+}
+
+// WithCompressor sets the Compressor used to compress outgoing payloads
+// larger than the compression threshold. The peer is consulted via a
+// handshake packet on connect, so compression is silently disabled if
+// the peer does not know this codec.
+func WithCompressor(c Compressor) PacketConnOption {
+	return func(o *packetConnOptions) {
+		o.compressor = c
+	}
+}
+
+// WithCompressionThreshold sets the minimum payload size, in bytes,
+// above which outgoing packets are compressed. Packets at or below the
+// threshold are always sent uncompressed. The default is 0, meaning
+// every packet is a candidate for compression once a Compressor is set.
+func WithCompressionThreshold(threshold uint32) PacketConnOption {
+	return func(o *packetConnOptions) {
+		o.compressionThreshold = threshold
+	}
+}
+
+// PacketConn manages sending and receiving packets on top of a network
+// connection, taking care of framing, pooling and optional compression.
+type PacketConn struct {
+	conn net.Conn
+
+	// framed is false for transports (e.g. websocket, via wsDriver)
+	// whose conn already delimits messages on its own, so PacketConn
+	// must not prepend its own size+flags header.
+	framed bool
+
+	compressor           Compressor
+	compressionThreshold uint32
+
+	recvChan chan *Packet
+	sendChan chan *Packet
+
+	closeOnce sync.Once
+	closeChan chan struct{}
+	closeErr  error
+}
+
+// NewPacketConn creates a PacketConn on top of conn and starts its
+// background send/recv loops. The returned PacketConn must eventually be
+// closed via Close to release the underlying connection.
+func NewPacketConn(ctx context.Context, conn net.Conn, opts ...PacketConnOption) *PacketConn {
+	return newPacketConn(ctx, conn, true, opts...)
+}
+
+// newPacketConn is NewPacketConn's implementation, plus the unexported
+// framed switch used by drivers (e.g. wsDriver) whose transport already
+// delimits messages and so shouldn't get PacketConn's own size header.
+func newPacketConn(ctx context.Context, conn net.Conn, framed bool, opts ...PacketConnOption) *PacketConn {
+	o := &packetConnOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	pc := &PacketConn{
+		conn:                 conn,
+		framed:               framed,
+		compressionThreshold: o.compressionThreshold,
+		recvChan:             make(chan *Packet, _RECV_CHAN_SIZE),
+		sendChan:             make(chan *Packet, _SEND_CHAN_SIZE),
+		closeChan:            make(chan struct{}),
+	}
+
+	if framed {
+		// Codec negotiation assumes the peer speaks PacketConn's own
+		// size+flags framing, which unframed transports don't.
+		pc.compressor = pc.negotiateCompressor(o.compressor)
+	}
+
+	go pc.recvLoop()
+	go pc.sendLoop()
+
+	go func() {
+		<-ctx.Done()
+		pc.Close()
+	}()
+
+	return pc
+}
+
+// RemoteAddr returns the remote address of the underlying connection
+func (pc *PacketConn) RemoteAddr() net.Addr {
+	return pc.conn.RemoteAddr()
+}
+
+// LocalAddr returns the local address of the underlying connection
+func (pc *PacketConn) LocalAddr() net.Addr {
+	return pc.conn.LocalAddr()
+}
+
+// Recv returns the channel of received packets. The channel is closed
+// when the connection is closed or encounters an error.
+func (pc *PacketConn) Recv() <-chan *Packet {
+	return pc.recvChan
+}
+
+// Send queues pkt to be sent on the connection. Send takes over pkt's
+// reference, releasing it once written (or once the connection closes).
+func (pc *PacketConn) Send(pkt *Packet) {
+	select {
+	case pc.sendChan <- pkt:
+	case <-pc.closeChan:
+		pkt.Release()
+	}
+}
+
+// Close closes the underlying connection and stops the send/recv loops.
+func (pc *PacketConn) Close() error {
+	pc.closeOnce.Do(func() {
+		close(pc.closeChan)
+		pc.closeErr = pc.conn.Close()
+	})
+	return pc.closeErr
+}
+
+// negotiateCompressor exchanges a short handshake packet with the peer
+// listing locally known codec names, so both sides silently degrade to
+// no compression when they don't share one. Every framed PacketConn
+// performs this handshake, regardless of whether it was configured with
+// WithCompressor, since NewPacketConn is used symmetrically by both the
+// dialing and accepting side and either one of them may be the one
+// asking for compression; a deadline keeps a peer that never sends its
+// side of the handshake (or doesn't speak it at all) from hanging
+// NewPacketConn forever.
+func (pc *PacketConn) negotiateCompressor(preferred Compressor) Compressor {
+	pc.conn.SetDeadline(time.Now().Add(_HANDSHAKE_TIMEOUT))
+	defer pc.conn.SetDeadline(time.Time{})
+
+	hs := allocPacket()
+	hs.setFlags(0)
+	hs.AppendStringList(registeredCompressorNames())
+	_, writeErr := pc.conn.Write(hs.data())
+	hs.Release()
+	if writeErr != nil {
+		return nil
+	}
+
+	peer := allocPacket()
+	defer peer.Release()
+
+	if _, err := peer.ReadFrom(pc.conn); err != nil {
+		return nil
+	}
+
+	if preferred == nil {
+		return nil
+	}
+
+	for _, name := range peer.ReadStringList() {
+		if name == preferred.Name() {
+			return preferred
+		}
+	}
+	return nil
+}
+
+// messageReader is implemented by transports (e.g. websocket, via
+// wsConn) whose ReadMessage hands back exactly one complete,
+// self-delimited application message, so PacketConn can skip reading
+// its own size+flags header for them.
+type messageReader interface {
+	ReadMessage() ([]byte, error)
+}
+
+func (pc *PacketConn) recvLoop() {
+	defer close(pc.recvChan)
+
+	mr, _ := pc.conn.(messageReader)
+
+	for {
+		pkt, err := pc.readPacket(mr)
+		if err != nil {
+			if pkt != nil {
+				pkt.Release()
+			}
+			return
+		}
+
+		if pc.framed && pkt.getFlags()&_FLAG_COMPRESSED != 0 {
+			decoded, ok := pc.decompress(pkt, pkt.getFlags())
+			if !ok {
+				pkt.Release()
+				return
+			}
+			pkt = decoded
+		}
+
+		select {
+		case pc.recvChan <- pkt:
+		case <-pc.closeChan:
+			pkt.Release()
+			return
+		}
+	}
+}
+
+func (pc *PacketConn) readPacket(mr messageReader) (*Packet, error) {
+	if !pc.framed && mr != nil {
+		data, err := mr.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		if uint32(len(data)) > _MAX_PAYLOAD_LENGTH {
+			return nil, fmt.Errorf("packetconn: message length %d exceeds max %d", len(data), _MAX_PAYLOAD_LENGTH)
+		}
+
+		pkt := allocPacket()
+		pkt.setFlags(0)
+		pkt.AppendBytes(data)
+		return pkt, nil
+	}
+
+	pkt := allocPacket()
+	_, err := pkt.ReadFrom(pc.conn)
+	return pkt, err
+}
+
+// RecvBatch drains up to len(dst) packets already queued on the
+// connection into dst in a single call, returning how many it wrote.
+// It blocks until at least one packet is available (or the connection
+// closes), but never waits for dst to fill up, so it's safe to call
+// with a large dst to amortize channel overhead on a busy connection.
+func (pc *PacketConn) RecvBatch(dst []*Packet) int {
+	if len(dst) == 0 {
+		return 0
+	}
+
+	pkt, ok := <-pc.recvChan
+	if !ok {
+		return 0
+	}
+	dst[0] = pkt
+
+	n := 1
+	for n < len(dst) {
+		select {
+		case pkt, ok := <-pc.recvChan:
+			if !ok {
+				return n
+			}
+			dst[n] = pkt
+			n++
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// flusher is implemented by transports (e.g. websocket) whose
+// underlying conn buffers writes into a single outgoing message rather
+// than writing each byte slice straight to the wire.
+type flusher interface {
+	Flush() error
+}
+
+func (pc *PacketConn) sendLoop() {
+	flush, _ := pc.conn.(flusher)
+
+	for {
+		select {
+		case pkt := <-pc.sendChan:
+			if pc.framed {
+				pkt = pc.maybeCompress(pkt)
+			}
+			err := pc.writePacket(pkt)
+			pkt.Release()
+			if err == nil && flush != nil {
+				err = flush.Flush()
+			}
+			if err != nil {
+				return
+			}
+		case <-pc.closeChan:
+			return
+		}
+	}
+}
+
+func (pc *PacketConn) writePacket(pkt *Packet) error {
+	if !pc.framed {
+		_, err := pc.conn.Write(pkt.Payload())
+		return err
+	}
+	_, err := pkt.WriteTo(pc.conn)
+	return err
+}
+
+// maybeCompress returns a packet ready to be written to the wire: either
+// pkt itself (flags cleared) or a new, smaller packet holding the
+// compressed payload. It always consumes pkt.
+func (pc *PacketConn) maybeCompress(pkt *Packet) *Packet {
+	if pc.compressor == nil || pkt.GetPayloadLen() <= pc.compressionThreshold {
+		pkt.setFlags(0)
+		return pkt
+	}
+
+	out := allocPacket()
+	dst := out.PreallocatedPayloadBuffer(pkt.GetPayloadLen())
+	compressed, err := pc.compressor.Compress(dst, pkt.Payload())
+	if err != nil || uint32(len(compressed)) >= pkt.GetPayloadLen() {
+		out.Release()
+		pkt.setFlags(0)
+		return pkt
+	}
+
+	out.AdoptPayload(compressed)
+	out.setFlags(_FLAG_COMPRESSED | compressorID(pc.compressor)<<_COMPRESSOR_ID_SHIFT)
+	out.compressedSize = uint32(len(compressed))
+	out.decompressedSize = pkt.GetPayloadLen()
+	pkt.Release()
+	return out
+}
+
+// decompress decodes a received packet whose flags indicate it was
+// compressed. On success it consumes pkt; on failure pkt is left for the
+// caller to release. The bool result is false when the codec id on the
+// wire is unknown, the codec fails to decode the payload, or the
+// decompressed size is unsafe to trust, meaning the stream can no
+// longer be trusted to be framed correctly. The decompressed-length check matters more here than the
+// wire-claimed length io.go's ReadFrom already guards: a small,
+// well-under-_MAX_PAYLOAD_LENGTH compressed packet can expand to an
+// enormous decompressed size (compression amplification), and that size
+// is fully attacker-controlled.
+func (pc *PacketConn) decompress(pkt *Packet, flags byte) (*Packet, bool) {
+	id := (flags >> _COMPRESSOR_ID_SHIFT) & _COMPRESSOR_ID_MASK
+	c := compressorByID(id)
+	if c == nil {
+		return nil, false
+	}
+
+	decompressed, err := c.Decompress(nil, pkt.Payload())
+	if err != nil {
+		return nil, false
+	}
+	if uint32(len(decompressed)) > _MAX_PAYLOAD_LENGTH {
+		return nil, false
+	}
+
+	out := allocPacket()
+	out.AppendBytes(decompressed)
+	out.compressedSize = pkt.GetPayloadLen()
+	out.decompressedSize = uint32(len(decompressed))
+	pkt.Release()
+	return out, true
+}
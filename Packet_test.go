@@ -0,0 +1,96 @@
+package packetconn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVarIntRoundTrip(t *testing.T) {
+	values := []int64{0, 1, -1, 127, -128, 1 << 20, -(1 << 20), 1<<62 - 1, -(1 << 62)}
+
+	pkt := allocPacket()
+	defer pkt.Release()
+	for _, v := range values {
+		pkt.AppendVarInt(v)
+	}
+	for _, want := range values {
+		if got := pkt.ReadVarInt(); got != want {
+			t.Fatalf("ReadVarInt() = %d, want %d", got, want)
+		}
+	}
+}
+
+func TestVarUintRoundTrip(t *testing.T) {
+	values := []uint64{0, 1, 127, 128, 1 << 20, 1<<63 - 1}
+
+	pkt := allocPacket()
+	defer pkt.Release()
+	for _, v := range values {
+		pkt.AppendVarUint(v)
+	}
+	for _, want := range values {
+		if got := pkt.ReadVarUint(); got != want {
+			t.Fatalf("ReadVarUint() = %d, want %d", got, want)
+		}
+	}
+}
+
+func TestAppendBytesRoundTrip(t *testing.T) {
+	pkt := allocPacket()
+	defer pkt.Release()
+
+	a := []byte("hello")
+	b := []byte("world, this is a longer chunk of bytes")
+	pkt.AppendBytes(a)
+	pkt.AppendBytes(b)
+
+	got := pkt.ReadBytes(uint32(len(a)))
+	if string(got) != string(a) {
+		t.Fatalf("ReadBytes(a) = %q, want %q", got, a)
+	}
+	got = pkt.ReadBytes(uint32(len(b)))
+	if string(got) != string(b) {
+		t.Fatalf("ReadBytes(b) = %q, want %q", got, b)
+	}
+}
+
+func TestAppendVarStrRoundTrip(t *testing.T) {
+	pkt := allocPacket()
+	defer pkt.Release()
+
+	want := "a varsize string with some length to it"
+	pkt.AppendVarStr(want)
+	if got := pkt.ReadVarStr(); got != want {
+		t.Fatalf("ReadVarStr() = %q, want %q", got, want)
+	}
+}
+
+func TestAppendMapStringStringRoundTrip(t *testing.T) {
+	pkt := allocPacket()
+	defer pkt.Release()
+
+	want := map[string]string{"a": "1", "bb": "22", "ccc": "333"}
+	pkt.AppendMapStringString(want)
+	got := pkt.ReadMapStringString()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ReadMapStringString() = %#v, want %#v", got, want)
+	}
+}
+
+func TestAssureCapacityGrowsAcrossBuckets(t *testing.T) {
+	pkt := allocPacket()
+	defer pkt.Release()
+
+	big := make([]byte, 1024*1024)
+	for i := range big {
+		big[i] = byte(i)
+	}
+	pkt.AppendBytes(big)
+
+	got := pkt.ReadBytes(uint32(len(big)))
+	for i := range big {
+		if got[i] != big[i] {
+			t.Fatalf("byte %d mismatch: got %d, want %d", i, got[i], big[i])
+		}
+	}
+}
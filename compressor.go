@@ -0,0 +1,195 @@
+package packetconn
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressor compresses and decompresses packet payloads for
+// PacketConn. Implementations must be safe for concurrent use, since a
+// single Compressor instance is shared by every PacketConn it is
+// attached to.
+type Compressor interface {
+	// Name identifies the codec on the wire and during handshake
+	// negotiation between peers.
+	Name() string
+	// Compress appends the compressed form of src to dst and returns
+	// the resulting slice.
+	Compress(dst, src []byte) ([]byte, error)
+	// Decompress appends the decompressed form of src to dst and
+	// returns the resulting slice.
+	Decompress(dst, src []byte) ([]byte, error)
+}
+
+var (
+	compressorsMu   sync.RWMutex
+	compressors     = map[string]Compressor{}
+	compressorIDs   = map[string]byte{}
+	compressorByIDs = map[byte]Compressor{}
+)
+
+// RegisterCompressor registers a Compressor under its Name so it can be
+// selected with WithCompressor and negotiated with peers during the
+// compression handshake. At most _COMPRESSOR_ID_MASK+1 compressors may
+// be registered, matching the size of the codec-id field in the wire
+// flags byte.
+func RegisterCompressor(c Compressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+
+	if _, exists := compressors[c.Name()]; exists {
+		panic(fmt.Errorf("compressor %q is already registered", c.Name()))
+	}
+
+	id := byte(len(compressors))
+	if id > _COMPRESSOR_ID_MASK {
+		panic(fmt.Errorf("RegisterCompressor: too many registered compressors"))
+	}
+
+	compressors[c.Name()] = c
+	compressorIDs[c.Name()] = id
+	compressorByIDs[id] = c
+}
+
+func registeredCompressorNames() []string {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+
+	names := make([]string, 0, len(compressors))
+	for name := range compressors {
+		names = append(names, name)
+	}
+	return names
+}
+
+func compressorID(c Compressor) byte {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	return compressorIDs[c.Name()]
+}
+
+func compressorByID(id byte) Compressor {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	return compressorByIDs[id]
+}
+
+func init() {
+	RegisterCompressor(gzipCompressor{})
+	RegisterCompressor(snappyCompressor{})
+	RegisterCompressor(zstdCompressor{})
+}
+
+// gzipCompressor implements Compressor using the standard library's
+// gzip package. It favors compatibility over speed.
+type gzipCompressor struct{}
+
+func (gzipCompressor) Name() string { return "gzip" }
+
+func (gzipCompressor) Compress(dst, src []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(dst, src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	// Cap the read at _MAX_PAYLOAD_LENGTH+1 rather than reading
+	// unbounded: a tiny gzip stream can decompress to an enormous
+	// amount of data (compression amplification), and the caller only
+	// wants to know it was too large, not hold all of it in memory.
+	decoded, err := ioutil.ReadAll(io.LimitReader(r, int64(_MAX_PAYLOAD_LENGTH)+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint32(len(decoded)) > _MAX_PAYLOAD_LENGTH {
+		return nil, fmt.Errorf("packetconn: gzip decoded length exceeds max %d", _MAX_PAYLOAD_LENGTH)
+	}
+	return append(dst, decoded...), nil
+}
+
+// snappyCompressor implements Compressor using github.com/golang/snappy,
+// trading some compression ratio for much lower CPU cost than gzip.
+type snappyCompressor struct{}
+
+func (snappyCompressor) Name() string { return "snappy" }
+
+// growForAppend returns dst with at least extra bytes of spare capacity
+// after len(dst), preserving dst's existing content, for use with
+// snappy.Encode/Decode: unlike gzip/zstd's own Compress/Decompress,
+// those two functions don't append to dst themselves (they overwrite
+// from index 0, reusing dst's backing array only if it's already long
+// enough), so the append has to be done by hand here.
+func growForAppend(dst []byte, extra int) []byte {
+	if cap(dst)-len(dst) >= extra {
+		return dst
+	}
+	grown := make([]byte, len(dst), len(dst)+extra)
+	copy(grown, dst)
+	return grown
+}
+
+func (snappyCompressor) Compress(dst, src []byte) ([]byte, error) {
+	base := growForAppend(dst, snappy.MaxEncodedLen(len(src)))
+	encoded := snappy.Encode(base[len(dst):cap(base)], src)
+	return base[:len(dst)+len(encoded)], nil
+}
+
+func (snappyCompressor) Decompress(dst, src []byte) ([]byte, error) {
+	n, err := snappy.DecodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if uint32(n) > _MAX_PAYLOAD_LENGTH {
+		return nil, fmt.Errorf("packetconn: snappy decoded length %d exceeds max %d", n, _MAX_PAYLOAD_LENGTH)
+	}
+
+	base := growForAppend(dst, n)
+	decoded, err := snappy.Decode(base[len(dst):cap(base)], src)
+	if err != nil {
+		return nil, err
+	}
+	return base[:len(dst)+len(decoded)], nil
+}
+
+// zstdCompressor implements Compressor using
+// github.com/klauspost/compress/zstd, which sits between snappy and
+// gzip on the speed/ratio tradeoff.
+type zstdCompressor struct{}
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	// WithDecoderMaxMemory bounds zstd's own internal allocation to
+	// _MAX_PAYLOAD_LENGTH, so a malicious stream claiming a huge
+	// decompressed size is rejected by the decoder itself instead of
+	// first being decoded and only checked afterward.
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(_MAX_PAYLOAD_LENGTH)))
+)
+
+func (zstdCompressor) Name() string { return "zstd" }
+
+func (zstdCompressor) Compress(dst, src []byte) ([]byte, error) {
+	return zstdEncoder.EncodeAll(src, dst), nil
+}
+
+func (zstdCompressor) Decompress(dst, src []byte) ([]byte, error) {
+	return zstdDecoder.DecodeAll(src, dst)
+}
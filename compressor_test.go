@@ -0,0 +1,99 @@
+package packetconn
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testCompressorRoundTrip(t *testing.T, c Compressor) {
+	t.Helper()
+
+	src := []byte(strings.Repeat("hello compressor world ", 100))
+	prefix := []byte("PFX:")
+
+	compressed, err := c.Compress(append([]byte{}, prefix...), src)
+	if err != nil {
+		t.Fatalf("Compress: %v", err)
+	}
+	if !bytes.HasPrefix(compressed, prefix) {
+		t.Fatalf("Compress overwrote dst instead of appending: got prefix %q", compressed[:len(prefix)])
+	}
+
+	decompressed, err := c.Decompress(append([]byte{}, prefix...), compressed[len(prefix):])
+	if err != nil {
+		t.Fatalf("Decompress: %v", err)
+	}
+	if !bytes.HasPrefix(decompressed, prefix) {
+		t.Fatalf("Decompress overwrote dst instead of appending: got prefix %q", decompressed[:len(prefix)])
+	}
+	if !bytes.Equal(decompressed[len(prefix):], src) {
+		t.Fatalf("round-trip mismatch for %s: got %d bytes, want %d bytes", c.Name(), len(decompressed)-len(prefix), len(src))
+	}
+}
+
+func TestGzipCompressorRoundTrip(t *testing.T) {
+	testCompressorRoundTrip(t, gzipCompressor{})
+}
+
+func TestSnappyCompressorRoundTrip(t *testing.T) {
+	testCompressorRoundTrip(t, snappyCompressor{})
+}
+
+func TestZstdCompressorRoundTrip(t *testing.T) {
+	testCompressorRoundTrip(t, zstdCompressor{})
+}
+
+func TestSnappyDecompressRejectsOversizedLength(t *testing.T) {
+	huge := bytes.Repeat([]byte{0}, int(_MAX_PAYLOAD_LENGTH)+1024)
+	compressed, err := snappyCompressor{}.Compress(nil, huge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := snappyCompressor{}
+	if _, err := c.Decompress(nil, compressed); err == nil {
+		t.Fatal("expected Decompress to reject an oversized decoded length")
+	}
+}
+
+func TestPacketConnDecompressRejectsBomb(t *testing.T) {
+	pc := &PacketConn{framed: true}
+
+	huge := bytes.Repeat([]byte{0}, int(_MAX_PAYLOAD_LENGTH)+1024)
+	compressed, err := gzipCompressor{}.Compress(nil, huge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkt := allocPacket()
+	pkt.AppendBytes(compressed)
+	flags := _FLAG_COMPRESSED | compressorID(gzipCompressor{})<<_COMPRESSOR_ID_SHIFT
+
+	if _, ok := pc.decompress(pkt, flags); ok {
+		t.Fatal("expected decompress to reject an oversized decompressed payload")
+	}
+}
+
+func TestMaybeCompressUsesPreallocatedBuffer(t *testing.T) {
+	pc := &PacketConn{compressor: snappyCompressor{}}
+
+	pkt := allocPacket()
+	pkt.AppendBytes([]byte(strings.Repeat("compress-me ", 200)))
+	payload := append([]byte{}, pkt.Payload()...)
+
+	out := pc.maybeCompress(pkt)
+
+	if out.getFlags()&_FLAG_COMPRESSED == 0 {
+		t.Fatal("expected payload to be compressed")
+	}
+
+	decompressed, ok := pc.decompress(out, out.getFlags())
+	if !ok {
+		t.Fatal("decompress failed")
+	}
+	defer decompressed.Release()
+
+	if !bytes.Equal(decompressed.Payload(), payload) {
+		t.Fatalf("round trip mismatch: got %d bytes, want %d bytes", len(decompressed.Payload()), len(payload))
+	}
+}
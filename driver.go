@@ -0,0 +1,169 @@
+package packetconn
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+)
+
+// Driver wraps an underlying transport into a PacketConn (or a listener
+// of them), so Dial/Listen can open connections of that kind by name.
+// This mirrors the factory pattern of database/sql.Register: a driver is
+// registered once by name and then addressed only through URLs.
+type Driver interface {
+	// DialContext dials addr (the URL's host[:port] followed by its
+	// path, scheme stripped) and wraps the resulting connection as a
+	// PacketConn.
+	DialContext(ctx context.Context, addr string, opts ...PacketConnOption) (*PacketConn, error)
+	// Listen starts listening on addr and returns a Listener that
+	// accepts incoming connections already wrapped as PacketConns.
+	Listen(ctx context.Context, addr string, opts ...PacketConnOption) (Listener, error)
+}
+
+// Listener accepts incoming connections already wrapped as PacketConns,
+// analogous to net.Listener.
+type Listener interface {
+	Accept() (*PacketConn, error)
+	Close() error
+	Addr() net.Addr
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   = map[string]Driver{}
+)
+
+// Register registers a Driver under name, so Dial and Listen can open
+// PacketConns of that kind via a "name://host:port" URL, e.g.
+// packetconn.Register("kcp", kcpDriver{}). Register panics if name is
+// already registered.
+func Register(name string, d Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if _, exists := drivers[name]; exists {
+		panic(fmt.Errorf("packetconn: Register called twice for driver %q", name))
+	}
+	drivers[name] = d
+}
+
+func lookupDriver(name string) (Driver, error) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	d, ok := drivers[name]
+	if !ok {
+		return nil, fmt.Errorf("packetconn: unknown driver %q (forgot to import it?)", name)
+	}
+	return d, nil
+}
+
+// Dial parses rawURL's scheme to pick a registered Driver and dials it,
+// e.g. Dial(ctx, "tcp://localhost:14572") or
+// Dial(ctx, "kcp://game.example.com:7000").
+func Dial(ctx context.Context, rawURL string, opts ...PacketConnOption) (*PacketConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := lookupDriver(u.Scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.DialContext(ctx, u.Host+u.Path, opts...)
+}
+
+// Listen parses rawURL's scheme to pick a registered Driver and listens
+// on it, e.g. Listen(ctx, "ws://0.0.0.0:14572/path").
+func Listen(ctx context.Context, rawURL string, opts ...PacketConnOption) (Listener, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := lookupDriver(u.Scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.Listen(ctx, u.Host+u.Path, opts...)
+}
+
+func init() {
+	Register("tcp", netDriver{network: "tcp"})
+	Register("unix", netDriver{network: "unix"})
+}
+
+// netDriver implements Driver directly on top of net.Dial/net.Listen for
+// stream-oriented transports (tcp, unix), using PacketConn's normal
+// size+flags-prefixed framing.
+type netDriver struct {
+	network string
+}
+
+func (d netDriver) DialContext(ctx context.Context, addr string, opts ...PacketConnOption) (*PacketConn, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, d.network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewPacketConn(ctx, conn, opts...), nil
+}
+
+func (d netDriver) Listen(ctx context.Context, addr string, opts ...PacketConnOption) (Listener, error) {
+	ln, err := net.Listen(d.network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &netListener{ln: ln, ctx: ctx, opts: opts}, nil
+}
+
+type netListener struct {
+	ln   net.Listener
+	ctx  context.Context
+	opts []PacketConnOption
+}
+
+func (l *netListener) Accept() (*PacketConn, error) {
+	conn, err := l.ln.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewPacketConn(l.ctx, conn, l.opts...), nil
+}
+
+func (l *netListener) Close() error   { return l.ln.Close() }
+func (l *netListener) Addr() net.Addr { return l.ln.Addr() }
+
+// NewTLSDriver returns a Driver that dials/listens over TLS using
+// config. Unlike tcp and unix, tls isn't auto-registered at init since
+// it has no sensible default certificate/verification settings; callers
+// register it themselves, e.g.
+// packetconn.Register("tls", packetconn.NewTLSDriver(cfg)).
+func NewTLSDriver(config *tls.Config) Driver {
+	return tlsDriver{config: config}
+}
+
+type tlsDriver struct {
+	config *tls.Config
+}
+
+func (d tlsDriver) DialContext(ctx context.Context, addr string, opts ...PacketConnOption) (*PacketConn, error) {
+	conn, err := (&tls.Dialer{Config: d.config}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewPacketConn(ctx, conn, opts...), nil
+}
+
+func (d tlsDriver) Listen(ctx context.Context, addr string, opts ...PacketConnOption) (Listener, error) {
+	ln, err := tls.Listen("tcp", addr, d.config)
+	if err != nil {
+		return nil, err
+	}
+	return &netListener{ln: ln, ctx: ctx, opts: opts}, nil
+}
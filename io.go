@@ -0,0 +1,58 @@
+package packetconn
+
+import (
+	"fmt"
+	"io"
+	"net"
+)
+
+// Buffers returns the packet's size+flags header and payload as two
+// slices aliasing the packet's internal buffer, suitable for a
+// scatter/gather net.Buffers.WriteTo (writev) without copying.
+func (p *Packet) Buffers() net.Buffers {
+	return net.Buffers{p.bytes[0:_PREPAYLOAD_SIZE], p.Payload()}
+}
+
+// WriteTo writes the packet, header and payload, to w. It lets callers
+// plumb packets through io.Copy, bufio, TLS or *os.File without going
+// through a PacketConn. When w is a *net.TCPConn, the header and payload
+// are written in a single writev syscall via net.Buffers.
+func (p *Packet) WriteTo(w io.Writer) (int64, error) {
+	bufs := p.Buffers()
+	return bufs.WriteTo(w)
+}
+
+// ReadFrom reads a framed packet, header then payload, from r into p,
+// replacing any existing payload. The payload buffer is resized via the
+// existing AssureCapacity/pool machinery, so the payload is read into a
+// pooled buffer; only the small size+flags header is allocated per call.
+// ReadFrom returns an error without touching p.bytes further if the
+// header claims a payload larger than _MAX_PAYLOAD_LENGTH, since that
+// can only mean a corrupt or hostile peer.
+func (p *Packet) ReadFrom(r io.Reader) (int64, error) {
+	p.ClearPayload()
+
+	header := make([]byte, _PREPAYLOAD_SIZE)
+	n, err := io.ReadFull(r, header)
+	if err != nil {
+		return int64(n), err
+	}
+
+	payloadLen := packetEndian.Uint32(header[:_SIZE_FIELD_SIZE])
+	flags := header[_SIZE_FIELD_SIZE]
+
+	if payloadLen > _MAX_PAYLOAD_LENGTH {
+		return int64(n), fmt.Errorf("packetconn: payload length %d exceeds max %d", payloadLen, _MAX_PAYLOAD_LENGTH)
+	}
+
+	p.AssureCapacity(payloadLen)
+	pn, err := io.ReadFull(r, p.bytes[_PREPAYLOAD_SIZE:_PREPAYLOAD_SIZE+payloadLen])
+	total := int64(n + pn)
+	if err != nil {
+		return total, err
+	}
+
+	p.setPayloadLen(payloadLen)
+	p.setFlags(flags)
+	return total, nil
+}
@@ -0,0 +1,40 @@
+package packetconn
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPacketWriteToReadFromRoundTrip(t *testing.T) {
+	pkt := allocPacket()
+	defer pkt.Release()
+	pkt.AppendBytes([]byte("round trip me"))
+
+	var buf bytes.Buffer
+	if _, err := pkt.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	got := allocPacket()
+	defer got.Release()
+	if _, err := got.ReadFrom(&buf); err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+
+	if string(got.Payload()) != "round trip me" {
+		t.Fatalf("ReadFrom() payload = %q, want %q", got.Payload(), "round trip me")
+	}
+}
+
+func TestReadFromRejectsOversizedLength(t *testing.T) {
+	header := make([]byte, _PREPAYLOAD_SIZE)
+	packetEndian.PutUint32(header[:_SIZE_FIELD_SIZE], _MAX_PAYLOAD_LENGTH+1)
+	buf := bytes.NewBuffer(header)
+
+	pkt := allocPacket()
+	defer pkt.Release()
+
+	if _, err := pkt.ReadFrom(buf); err == nil {
+		t.Fatal("expected ReadFrom to reject a payload length over _MAX_PAYLOAD_LENGTH")
+	}
+}
@@ -0,0 +1,170 @@
+package packetconn
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// typeSizeCache caches the encoded size of a reflect.Type so AppendValue
+// only has to walk a struct's fields to size it once per distinct type,
+// no matter how many instances of it are appended. Encoding still walks
+// the fields on every call.
+var typeSizeCache sync.Map // map[reflect.Type]uint32
+
+// Sizeof returns the number of bytes AppendValue would write for v. v
+// may be a fixed-size value or a pointer to one.
+func Sizeof(v interface{}) uint32 {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if cached, ok := typeSizeCache.Load(t); ok {
+		return cached.(uint32)
+	}
+
+	size := sizeofType(t)
+	typeSizeCache.Store(t, size)
+	return size
+}
+
+func sizeofType(t reflect.Type) uint32 {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		return 1
+	case reflect.Int16, reflect.Uint16:
+		return 2
+	case reflect.Int32, reflect.Uint32, reflect.Float32:
+		return 4
+	case reflect.Int64, reflect.Uint64, reflect.Float64:
+		return 8
+	case reflect.Array:
+		return uint32(t.Len()) * sizeofType(t.Elem())
+	case reflect.Struct:
+		var size uint32
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" { // unexported field
+				continue
+			}
+			size += sizeofType(t.Field(i).Type)
+		}
+		return size
+	default:
+		panic(fmt.Errorf("packetconn: type %s is not fixed-size", t))
+	}
+}
+
+// AppendValue appends v to the end of payload using the packet's
+// existing little-endian layout, mirroring encoding/binary's handling
+// of fixed-size arithmetic types, arrays and structs of fixed-size
+// fields. Unexported struct fields are skipped. v may be a value or a
+// pointer to one.
+//
+// Slices, maps, strings and interfaces aren't fixed-size and cause a
+// panic; keep using AppendVarStr/AppendVarBytesV/etc. for those.
+func (p *Packet) AppendValue(v interface{}) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+
+	p.AssureCapacity(Sizeof(v))
+	appendReflectValue(p, rv)
+}
+
+// ReadValue reads into v, which must be a pointer, the same layout
+// AppendValue would have written for it.
+func (p *Packet) ReadValue(v interface{}) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr {
+		panic(fmt.Errorf("packetconn: ReadValue requires a pointer, got %s", rv.Type()))
+	}
+	rv = rv.Elem()
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	readReflectValue(p, rv)
+}
+
+func appendReflectValue(p *Packet, rv reflect.Value) {
+	switch rv.Kind() {
+	case reflect.Bool:
+		p.AppendBool(rv.Bool())
+	case reflect.Int8:
+		p.AppendByte(byte(rv.Int()))
+	case reflect.Uint8:
+		p.AppendByte(byte(rv.Uint()))
+	case reflect.Int16:
+		p.AppendUint16(uint16(rv.Int()))
+	case reflect.Uint16:
+		p.AppendUint16(uint16(rv.Uint()))
+	case reflect.Int32:
+		p.AppendUint32(uint32(rv.Int()))
+	case reflect.Uint32:
+		p.AppendUint32(uint32(rv.Uint()))
+	case reflect.Float32:
+		p.AppendFloat32(float32(rv.Float()))
+	case reflect.Int64:
+		p.AppendUint64(uint64(rv.Int()))
+	case reflect.Uint64:
+		p.AppendUint64(rv.Uint())
+	case reflect.Float64:
+		p.AppendFloat64(rv.Float())
+	case reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			appendReflectValue(p, rv.Index(i))
+		}
+	case reflect.Struct:
+		t := rv.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				continue
+			}
+			appendReflectValue(p, rv.Field(i))
+		}
+	default:
+		panic(fmt.Errorf("packetconn: type %s is not fixed-size", rv.Type()))
+	}
+}
+
+func readReflectValue(p *Packet, rv reflect.Value) {
+	switch rv.Kind() {
+	case reflect.Bool:
+		rv.SetBool(p.ReadBool())
+	case reflect.Int8:
+		rv.SetInt(int64(int8(p.ReadOneByte())))
+	case reflect.Uint8:
+		rv.SetUint(uint64(p.ReadOneByte()))
+	case reflect.Int16:
+		rv.SetInt(int64(p.ReadInt16()))
+	case reflect.Uint16:
+		rv.SetUint(uint64(p.ReadUint16()))
+	case reflect.Int32:
+		rv.SetInt(int64(int32(p.ReadUint32())))
+	case reflect.Uint32:
+		rv.SetUint(uint64(p.ReadUint32()))
+	case reflect.Float32:
+		rv.SetFloat(float64(p.ReadFloat32()))
+	case reflect.Int64:
+		rv.SetInt(int64(p.ReadUint64()))
+	case reflect.Uint64:
+		rv.SetUint(p.ReadUint64())
+	case reflect.Float64:
+		rv.SetFloat(p.ReadFloat64())
+	case reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			readReflectValue(p, rv.Index(i))
+		}
+	case reflect.Struct:
+		t := rv.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				continue
+			}
+			readReflectValue(p, rv.Field(i))
+		}
+	default:
+		panic(fmt.Errorf("packetconn: type %s is not fixed-size", rv.Type()))
+	}
+}
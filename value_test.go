@@ -0,0 +1,61 @@
+package packetconn
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testStruct struct {
+	A int32
+	B uint8
+	C float64
+	D [3]uint16
+}
+
+func TestAppendValueReadValueRoundTrip(t *testing.T) {
+	want := testStruct{A: -42, B: 200, C: 3.25, D: [3]uint16{1, 2, 3}}
+
+	pkt := allocPacket()
+	defer pkt.Release()
+	pkt.AppendValue(&want)
+
+	var got testStruct
+	pkt.ReadValue(&got)
+	if got != want {
+		t.Fatalf("ReadValue() = %+v, want %+v", got, want)
+	}
+}
+
+func TestAppendValueReadValueDoublePointer(t *testing.T) {
+	want := testStruct{A: 7, B: 1, C: 2.5, D: [3]uint16{4, 5, 6}}
+	p := &want
+
+	if got := Sizeof(&p); got != Sizeof(want) {
+		t.Fatalf("Sizeof(&&v) = %d, want %d", got, Sizeof(want))
+	}
+
+	pkt := allocPacket()
+	defer pkt.Release()
+	pkt.AppendValue(&p)
+
+	var got testStruct
+	gp := &got
+	pkt.ReadValue(&gp)
+	if got != want {
+		t.Fatalf("ReadValue() through double pointer = %+v, want %+v", got, want)
+	}
+}
+
+func TestSizeofCachesByType(t *testing.T) {
+	a := testStruct{}
+	b := testStruct{A: 1}
+	if Sizeof(a) != Sizeof(b) {
+		t.Fatalf("Sizeof should only depend on type, not value")
+	}
+	if _, ok := typeSizeCache.Load(reflect.TypeOf(a)); !ok {
+		t.Fatalf("Sizeof did not cache the size of %T", a)
+	}
+	if Sizeof(a) != 4+1+8+3*2 {
+		t.Fatalf("Sizeof(testStruct) = %d, want %d", Sizeof(a), 4+1+8+3*2)
+	}
+}
@@ -0,0 +1,181 @@
+package packetconn
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsDriver implements Driver over binary WebSocket frames. Since WS
+// frames are already length-delimited, PacketConn is told not to frame
+// (see the framed field) and instead reads/writes whole messages via
+// wsConn's messageReader/flusher support.
+type wsDriver struct {
+	dialer *websocket.Dialer
+}
+
+func init() {
+	Register("ws", wsDriver{dialer: websocket.DefaultDialer})
+}
+
+func (d wsDriver) DialContext(ctx context.Context, addr string, opts ...PacketConnOption) (*PacketConn, error) {
+	conn, _, err := d.dialer.DialContext(ctx, "ws://"+addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newPacketConn(ctx, newWSConn(conn), false, opts...), nil
+}
+
+// Listen starts an http.Server on addr (host[:port] plus an optional
+// "/path" suffix, e.g. "0.0.0.0:14572/path") that upgrades every request
+// on that path and hands the result to the returned Listener's Accept.
+// Like netListener, ctx is threaded into every accepted PacketConn (so
+// canceling it closes them all) but does not itself stop the listener;
+// call the returned Listener's Close for that.
+func (d wsDriver) Listen(ctx context.Context, addr string, opts ...PacketConnOption) (Listener, error) {
+	host, path := addr, "/"
+	if i := strings.IndexByte(addr, '/'); i >= 0 {
+		host, path = addr[:i], addr[i:]
+	}
+
+	ln, err := net.Listen("tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &wsListener{
+		ln:       ln,
+		ctx:      ctx,
+		connChan: make(chan *PacketConn),
+		errChan:  make(chan error, 1),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		_ = handleWSUpgrade(l.ctx, w, r, func(pc *PacketConn) {
+			l.connChan <- pc
+		}, opts...)
+	})
+	l.server = &http.Server{Handler: mux}
+
+	go func() {
+		l.errChan <- l.server.Serve(ln)
+	}()
+
+	return l, nil
+}
+
+// wsListener adapts an http.Server upgrading WS requests on a mux path
+// into the accept-one-at-a-time shape of Listener.
+type wsListener struct {
+	ln       net.Listener
+	ctx      context.Context
+	server   *http.Server
+	connChan chan *PacketConn
+	errChan  chan error
+}
+
+func (l *wsListener) Accept() (*PacketConn, error) {
+	select {
+	case pc := <-l.connChan:
+		return pc, nil
+	case err := <-l.errChan:
+		return nil, err
+	}
+}
+
+func (l *wsListener) Close() error   { return l.ln.Close() }
+func (l *wsListener) Addr() net.Addr { return l.ln.Addr() }
+
+// HandleWSUpgrade upgrades r inside an http.Handler and passes the
+// resulting connection, already wrapped as a PacketConn, to accept.
+// It's the server-side entry point wsDriver's Listen builds on; use it
+// directly instead when the ws endpoint has to share an existing
+// http.Server/mux rather than owning one.
+//
+// The PacketConn is intentionally given context.Background() rather
+// than r.Context(): the request's context is canceled as soon as the
+// handler returns, which happens right after accept(pc) here, and that
+// would otherwise close the connection before it had done any work.
+// Callers that do have a longer-lived context to tie the connection's
+// lifetime to (as wsDriver.Listen does with the context passed to
+// Listen) should use that instead of context.Background().
+func HandleWSUpgrade(w http.ResponseWriter, r *http.Request, accept func(*PacketConn), opts ...PacketConnOption) error {
+	return handleWSUpgrade(context.Background(), w, r, accept, opts...)
+}
+
+func handleWSUpgrade(ctx context.Context, w http.ResponseWriter, r *http.Request, accept func(*PacketConn), opts ...PacketConnOption) error {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+	accept(newPacketConn(ctx, newWSConn(conn), false, opts...))
+	return nil
+}
+
+// wsConn adapts a *websocket.Conn to the net.Conn shape PacketConn
+// expects. ReadMessage/Flush let PacketConn read and write whole WS
+// messages directly (see messageReader/flusher) instead of going
+// through its own size-prefixed framing: PacketConn Writes each payload
+// into writeBuf and Flush sends it as one message. Read still exists to
+// satisfy net.Conn but isn't used by PacketConn for this driver.
+type wsConn struct {
+	conn     *websocket.Conn
+	readBuf  *bytes.Reader
+	writeBuf bytes.Buffer
+}
+
+func newWSConn(conn *websocket.Conn) *wsConn {
+	return &wsConn{conn: conn}
+}
+
+// ReadMessage returns the next whole binary WS message, with no
+// PacketConn framing to strip.
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	_, data, err := c.conn.ReadMessage()
+	return data, err
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	for c.readBuf == nil || c.readBuf.Len() == 0 {
+		data, err := c.ReadMessage()
+		if err != nil {
+			return 0, err
+		}
+		c.readBuf = bytes.NewReader(data)
+	}
+	return c.readBuf.Read(p)
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	return c.writeBuf.Write(p)
+}
+
+// Flush sends everything buffered since the last Flush as one binary WS
+// message.
+func (c *wsConn) Flush() error {
+	if c.writeBuf.Len() == 0 {
+		return nil
+	}
+	err := c.conn.WriteMessage(websocket.BinaryMessage, c.writeBuf.Bytes())
+	c.writeBuf.Reset()
+	return err
+}
+
+func (c *wsConn) Close() error                       { return c.conn.Close() }
+func (c *wsConn) LocalAddr() net.Addr                { return c.conn.LocalAddr() }
+func (c *wsConn) RemoteAddr() net.Addr               { return c.conn.RemoteAddr() }
+func (c *wsConn) SetReadDeadline(t time.Time) error  { return c.conn.SetReadDeadline(t) }
+func (c *wsConn) SetWriteDeadline(t time.Time) error { return c.conn.SetWriteDeadline(t) }
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}